@@ -16,147 +16,134 @@
 package apm // import "contrib.go.opencensus.io/exporter/apm"
 
 import (
-	"bytes"
-	"log"
+	"context"
 	"net/http"
 	"net/url"
 	"fmt"
-	"go.elastic.co/fastjson"
 	apm "go.elastic.co/apm/model"
 	"go.opencensus.io/trace"
-	"strconv"
+	"os"
+	"sync"
+	"sync/atomic"
 )
 
 const defaultServiceName = "OpenCensus"
 
-// NewExporter returns a trace.Exporter implementation that exports
-// the collected spans to APM.
-func NewExporter(url string) *Exporter {
-	return &Exporter{
-		Url: url,
-		client: &http.Client{},
-	}
-}
-
-// Exporter is an implementation of trace.Exporter that uploads spans to APM.
-type Exporter struct {
-	Url string
-	client *http.Client
-}
-
-var _ trace.Exporter = (*Exporter)(nil)
-
-// ExportSpan exports a SpanData to APM.
-func (e *Exporter) ExportSpan(data *trace.SpanData) {}
-
-// Flush waits for exported trace spans to be uploaded.
+// NewExporter returns a trace.Exporter implementation that uploads spans to
+// APM Server in batches from a background goroutine.
 //
-// This is useful if your program is ending and you do not want to lose recent spans.
-func (e *Exporter) Flush() {}
-
-// As per the OpenCensus Status code mapping in
-//    https://opencensus.io/tracing/span/status/
-// the status is OK if the code is 0.
-const opencensusStatusCodeOK = 0
-
-func spanDataToAPM(data *trace.SpanData) *apm.Transaction {
-	sampled := data.SpanContext.TraceOptions.IsSampled()
-
-	tagsMap := tagsToMap(data.Attributes)
+// url may be left empty to pick it up from the ELASTIC_APM_SERVER_URL
+// environment variable, matching the official Elastic Go agent.
+//
+// The returned Exporter must eventually be stopped with Close so that its
+// background worker can exit cleanly.
+func NewExporter(url string, options Options) *Exporter {
+	options = options.withDefaults()
 
-	tags := apm.StringMap{
-		apm.StringMapItem{Key: "status.code", Value: fmt.Sprintf("%d", data.Status.Code)},
-		apm.StringMapItem{Key: "status.message", Value: data.Status.Message},
+	if url == "" {
+		url = os.Getenv("ELASTIC_APM_SERVER_URL")
 	}
 
-	// Ensure that if Status.Code is not OK, that we set the "error" tag on the APM span.
-	// See Issue https://github.com/census-instrumentation/opencensus-go/issues/1041
-	if data.Status.Code != opencensusStatusCodeOK {
-		tags = append(tags, apm.StringMapItem{Key: "error", Value: "true"})
+	client := options.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+		if options.TLSConfig != nil {
+			client.Transport = &http.Transport{TLSClientConfig: options.TLSConfig}
+		}
 	}
 
-	for key, value := range tagsMap {
-		tags = append(tags, apm.StringMapItem{Key: key, Value: value})
+	e := &Exporter{
+		Url:     url,
+		client:  client,
+		options: options,
+		queue:   make(chan interface{}, options.BufferMaxSize),
+		flushCh: make(chan chan struct{}),
+		closeCh: make(chan chan struct{}),
 	}
 
-	var request *apm.Request
+	e.wg.Add(1)
+	go e.run()
 
-	if tagsMap["http.host"] != "" {
-		request = &apm.Request{
-			URL: tagsToURL(tagsMap),
-			Method: tagsMap["http.method"],
-		}
+	return e
+}
 
-		if tagsMap["http.user_agent"] != "" {
-			request.Headers = []apm.Header{
-				{
-					Key:    "User-Agent",
-					Values: []string{tagsMap["http.user_agent"]},
-				},
-			}
-		}
-	}
+// Exporter is an implementation of trace.Exporter and view.Exporter that
+// uploads spans and stats to APM Server over a single HTTP connection.
+type Exporter struct {
+	Url    string
+	client *http.Client
 
-	var response *apm.Response
-	if tagsMap["http.status_code"] != "" {
-		statusCode, _ := strconv.Atoi(tagsMap["http.status_code"])
-		response = &apm.Response{StatusCode: statusCode}
-	}
+	options Options
 
-	return &apm.Transaction{
-		ID:        apm.SpanID(data.SpanContext.SpanID),
-		TraceID:   apm.TraceID(data.SpanContext.TraceID),
-		ParentID:  apm.SpanID(data.ParentSpanID),
-		Name:      data.Name,
-		Timestamp: apm.Time(data.StartTime),
-		Duration:  float64(data.EndTime.Sub(data.StartTime)),
-		Type:      fmt.Sprintf("%d", data.SpanKind),
-		Result:    data.Status.Message,
-		SpanCount: apm.SpanCount{
-			Dropped: 0,
-			Started: data.ChildSpanCount,
-		},
-		Context: &apm.Context{
-			Tags: tags,
-			//Service: serviceToAPM(proc),
-			Request: request,
-			Response: response,
-		},
-		Sampled: &sampled,
-	}
+	// queue carries *trace.SpanData, produced by ExportSpan, and
+	// *view.Data, produced by ExportView, to the background worker.
+	queue   chan interface{}
+	dropped uint64
+	flushCh chan chan struct{}
+	closeCh chan chan struct{}
+	wg      sync.WaitGroup
 }
 
-func (e *Exporter) sendToAPM(transaction *apm.Transaction) error {
-	var transactionEncoded fastjson.Writer
-	fastjson.Marshal(&transactionEncoded, transaction)
-
-	var metadata fastjson.Writer
-	fastjson.Marshal(&metadata, &apm.Service{
-		Name: "apm-gateway",
-		Agent: &apm.Agent{
-			Name:    "apm-gateway",
-			Version: "0.0.1",
-		},
-	})
+var _ trace.Exporter = (*Exporter)(nil)
+
+// ExportSpan exports a SpanData to APM. It never blocks: if the export
+// queue is full, the span is dropped and the dropped count is incremented.
+func (e *Exporter) ExportSpan(data *trace.SpanData) {
+	e.enqueue(data)
+}
+
+// enqueue pushes item (a *trace.SpanData or *view.Data) onto the export
+// queue without blocking, incrementing the dropped count if it is full.
+func (e *Exporter) enqueue(item interface{}) {
+	select {
+	case e.queue <- item:
+	default:
+		atomic.AddUint64(&e.dropped, 1)
+	}
+}
 
-	buf := &bytes.Buffer{}
-	buf.Write([]byte("{\"metadata\":{\"service\":"))
-	buf.Write(metadata.Bytes())
-	buf.Write([]byte("}}\n{\"transaction\":"))
-	buf.Write(transactionEncoded.Bytes())
-	buf.Write([]byte("}\n"))
+// Dropped returns the number of records dropped so far because the export
+// queue was full.
+func (e *Exporter) Dropped() uint64 {
+	return atomic.LoadUint64(&e.dropped)
+}
 
-	log.Println(string(buf.Bytes()))
+// Flush blocks until every span queued so far has been sent to APM Server,
+// or until ctx is done, whichever happens first.
+//
+// This is useful if your program is ending and you do not want to lose recent spans.
+func (e *Exporter) Flush(ctx context.Context) error {
+	reply := make(chan struct{})
 
-	resp, err := e.client.Post(e.Url, "application/x-ndjson", buf)
+	select {
+	case e.flushCh <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
-	if err := resp.Body.Close(); err != nil {
-		return err
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	return err
+// Close flushes any spans/stats queued so far to APM Server and stops the
+// background worker started by NewExporter. The Exporter must not be used
+// after Close returns.
+func (e *Exporter) Close() {
+	reply := make(chan struct{})
+	e.closeCh <- reply
+	<-reply
+	e.wg.Wait()
 }
 
+// As per the OpenCensus Status code mapping in
+//    https://opencensus.io/tracing/span/status/
+// the status is OK if the code is 0.
+const opencensusStatusCodeOK = 0
+
 func tagsToMap(attributes map[string]interface{}) map[string]string {
 	tags := map[string]string{}
 	for k, v := range attributes {
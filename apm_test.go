@@ -24,7 +24,7 @@ import (
 	"net/url"
 )
 
-func Test_spanDataToAPM(t *testing.T) {
+func Test_spanDataToTransaction(t *testing.T) {
 	now := time.Now()
 
 	keyValue := "value"
@@ -62,26 +62,27 @@ func Test_spanDataToAPM(t *testing.T) {
 				Timestamp: apm.Time(now),
 				Sampled: &boolTrue,
 				Context: &apm.Context{
-					Tags: apm.StringMap{
-						apm.StringMapItem{"status.code", "2"},
-						apm.StringMapItem{"status.message", "error"},
-						apm.StringMapItem{"error", "true"},
-						apm.StringMapItem{"key", "value"},
-						apm.StringMapItem{"double", "123.456000"},
+					Tags: apm.IfaceMap{
+						apm.IfaceMapItem{"status.code", "2"},
+						apm.IfaceMapItem{"status.message", "error"},
+						apm.IfaceMapItem{"error", "true"},
+						apm.IfaceMapItem{"key", "value"},
+						apm.IfaceMapItem{"double", "123.456000"},
 					},
 				},
-				Type: "0",
+				Type: "unknown",
 			},
 		},
 		{
-			name: "parent",
+			name: "server span with parent",
 			data: &trace.SpanData{
 				SpanContext: trace.SpanContext{
 					TraceID: trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
 					SpanID:  trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
 					TraceOptions: trace.TraceOptions(1),
 				},
-				ParentSpanID:  trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				ParentSpanID: trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				SpanKind:     trace.SpanKindServer,
 				Name:      "/foo",
 				StartTime: now,
 				EndTime:   now,
@@ -100,15 +101,15 @@ func Test_spanDataToAPM(t *testing.T) {
 				Timestamp: apm.Time(now),
 				Sampled: &boolTrue,
 				Context: &apm.Context{
-					Tags: apm.StringMap{
-						apm.StringMapItem{"status.code", "2"},
-						apm.StringMapItem{"status.message", "error"},
-						apm.StringMapItem{"error", "true"},
-						apm.StringMapItem{"key", "value"},
-						apm.StringMapItem{"double", "123.456000"},
+					Tags: apm.IfaceMap{
+						apm.IfaceMapItem{"status.code", "2"},
+						apm.IfaceMapItem{"status.message", "error"},
+						apm.IfaceMapItem{"error", "true"},
+						apm.IfaceMapItem{"key", "value"},
+						apm.IfaceMapItem{"double", "123.456000"},
 					},
 				},
-				Type: "0",
+				Type: "unknown",
 			},
 		},
 		{
@@ -141,17 +142,17 @@ func Test_spanDataToAPM(t *testing.T) {
 				Timestamp: apm.Time(now),
 				Sampled: &boolTrue,
 				Context: &apm.Context{
-					Tags: apm.StringMap{
-						apm.StringMapItem{"status.code", "2"},
-						apm.StringMapItem{"status.message", "error"},
-						apm.StringMapItem{"error", "true"},
-						apm.StringMapItem{"key", "value"},
-						apm.StringMapItem{"double", "123.456000"},
-						apm.StringMapItem{"http.host", "google.com:8080"},
-						apm.StringMapItem{"http.status_code", "200"},
-						apm.StringMapItem{"http.path", "/"},
-						apm.StringMapItem{"http.method", "GET"},
-						apm.StringMapItem{"http.user_agent", "curl/1.4"},
+					Tags: apm.IfaceMap{
+						apm.IfaceMapItem{"status.code", "2"},
+						apm.IfaceMapItem{"status.message", "error"},
+						apm.IfaceMapItem{"error", "true"},
+						apm.IfaceMapItem{"key", "value"},
+						apm.IfaceMapItem{"double", "123.456000"},
+						apm.IfaceMapItem{"http.host", "google.com:8080"},
+						apm.IfaceMapItem{"http.status_code", "200"},
+						apm.IfaceMapItem{"http.path", "/"},
+						apm.IfaceMapItem{"http.method", "GET"},
+						apm.IfaceMapItem{"http.user_agent", "curl/1.4"},
 					},
 					Request: &apm.Request{
 						URL: apm.URL{
@@ -170,13 +171,13 @@ func Test_spanDataToAPM(t *testing.T) {
 						StatusCode: 200,
 					},
 				},
-				Type: "0",
+				Type: "request",
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := spanDataToAPM(tt.data)
+			got := spanDataToTransaction(tt.data)
 
 			sort.Slice(got.Context.Tags, func(i, j int) bool {
 				return got.Context.Tags[i].Key < got.Context.Tags[j].Key
@@ -190,6 +191,155 @@ func Test_spanDataToAPM(t *testing.T) {
 	}
 }
 
+func Test_spanDataToSpan(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		data *trace.SpanData
+		want *apm.Span
+	}{
+		{
+			name: "internal span with parent",
+			data: &trace.SpanData{
+				SpanContext: trace.SpanContext{
+					TraceID: trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+					SpanID:  trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+					TraceOptions: trace.TraceOptions(1),
+				},
+				ParentSpanID: trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				Name:      "do-work",
+				StartTime: now,
+				EndTime:   now,
+				Status:    trace.Status{Code: opencensusStatusCodeOK},
+			},
+			want: &apm.Span{
+				Name:          "do-work",
+				ID:            apm.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				TraceID:       apm.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				TransactionID: apm.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				ParentID:      apm.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				Timestamp:     apm.Time(now),
+				Type:          "app",
+				Subtype:       "internal",
+				Context: &apm.SpanContext{
+					Tags: apm.IfaceMap{
+						apm.IfaceMapItem{"status.code", "0"},
+						apm.IfaceMapItem{"status.message", ""},
+					},
+				},
+			},
+		},
+		{
+			name: "db span",
+			data: &trace.SpanData{
+				SpanContext: trace.SpanContext{
+					TraceID: trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+					SpanID:  trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+					TraceOptions: trace.TraceOptions(1),
+				},
+				ParentSpanID: trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				Name:      "SELECT",
+				StartTime: now,
+				EndTime:   now,
+				Attributes: map[string]interface{}{
+					"db.type":      "sql",
+					"db.instance":  "orders",
+					"db.statement": "SELECT 1",
+				},
+				Status: trace.Status{Code: opencensusStatusCodeOK},
+			},
+			want: &apm.Span{
+				Name:          "SELECT",
+				ID:            apm.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				TraceID:       apm.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				TransactionID: apm.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				ParentID:      apm.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				Timestamp:     apm.Time(now),
+				Type:          "db",
+				Subtype:       "sql",
+				Context: &apm.SpanContext{
+					Tags: apm.IfaceMap{
+						apm.IfaceMapItem{"status.code", "0"},
+						apm.IfaceMapItem{"status.message", ""},
+						apm.IfaceMapItem{"db.type", "sql"},
+						apm.IfaceMapItem{"db.instance", "orders"},
+						apm.IfaceMapItem{"db.statement", "SELECT 1"},
+					},
+					Database: &apm.DatabaseSpanContext{
+						Type:      "sql",
+						Instance:  "orders",
+						Statement: "SELECT 1",
+					},
+				},
+			},
+		},
+		{
+			// Known limitation: trace.Exporter only sees one finished
+			// SpanData at a time, so for a span nested two levels deep
+			// (a child of a child of the transaction), TransactionID ends
+			// up set to the immediate parent's ID rather than the true
+			// root transaction's ID. This test pins that documented
+			// behavior down rather than claiming it's correct.
+			name: "grandchild span (known limitation)",
+			data: &trace.SpanData{
+				SpanContext: trace.SpanContext{
+					TraceID:      trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+					SpanID:       trace.SpanID{3, 3, 3, 3, 3, 3, 3, 3},
+					TraceOptions: trace.TraceOptions(1),
+				},
+				ParentSpanID: trace.SpanID{2, 2, 2, 2, 2, 2, 2, 2},
+				Name:         "grandchild-work",
+				StartTime:    now,
+				EndTime:      now,
+				Status:       trace.Status{Code: opencensusStatusCodeOK},
+			},
+			want: &apm.Span{
+				Name:          "grandchild-work",
+				ID:            apm.SpanID{3, 3, 3, 3, 3, 3, 3, 3},
+				TraceID:       apm.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				TransactionID: apm.SpanID{2, 2, 2, 2, 2, 2, 2, 2},
+				ParentID:      apm.SpanID{2, 2, 2, 2, 2, 2, 2, 2},
+				Timestamp:     apm.Time(now),
+				Type:          "app",
+				Subtype:       "internal",
+				Context: &apm.SpanContext{
+					Tags: apm.IfaceMap{
+						apm.IfaceMapItem{"status.code", "0"},
+						apm.IfaceMapItem{"status.message", ""},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := spanDataToSpan(tt.data)
+
+			sort.Slice(got.Context.Tags, func(i, j int) bool {
+				return got.Context.Tags[i].Key < got.Context.Tags[j].Key
+			})
+			sort.Slice(tt.want.Context.Tags, func(i, j int) bool {
+				return tt.want.Context.Tags[i].Key < tt.want.Context.Tags[j].Key
+			})
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIsTransaction(t *testing.T) {
+	assert.True(t, isTransaction(&trace.SpanData{}))
+	assert.True(t, isTransaction(&trace.SpanData{
+		ParentSpanID: trace.SpanID{1},
+		SpanKind:     trace.SpanKindServer,
+	}))
+	assert.False(t, isTransaction(&trace.SpanData{
+		ParentSpanID: trace.SpanID{1},
+		SpanKind:     trace.SpanKindClient,
+	}))
+}
+
 func TestTagsToURL(t *testing.T) {
 	parsed, _ := url.Parse("http://google.com:8080/hello")
 	assert.Equal(t, tagsToURL(map[string]string{
@@ -0,0 +1,258 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	apm "go.elastic.co/apm/model"
+	"go.elastic.co/fastjson"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+)
+
+const (
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 30 * time.Second
+	maxSendRetries = 5
+)
+
+// apmStatusError is returned by postBatch when APM Server responds with a
+// non-2xx status code.
+type apmStatusError struct {
+	StatusCode int
+}
+
+func (e *apmStatusError) Error() string {
+	return fmt.Sprintf("apm: server responded with status %d", e.StatusCode)
+}
+
+// run drains the export queue, batching spans into NDJSON requests of at
+// most MaxBatchSize records, and flushes early every MaxBatchInterval. It
+// exits once Close requests it, after flushing anything left over.
+func (e *Exporter) run() {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.options.MaxBatchInterval)
+	defer ticker.Stop()
+
+	batch := make([]interface{}, 0, e.options.MaxBatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		e.sendBatch(batch)
+		batch = batch[:0]
+	}
+
+	drainQueue := func() {
+		for {
+			select {
+			case data := <-e.queue:
+				batch = append(batch, data)
+				if len(batch) >= e.options.MaxBatchSize {
+					flush()
+				}
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case data := <-e.queue:
+			batch = append(batch, data)
+			if len(batch) >= e.options.MaxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case reply := <-e.flushCh:
+			drainQueue()
+			flush()
+			close(reply)
+		case reply := <-e.closeCh:
+			drainQueue()
+			flush()
+			close(reply)
+			return
+		}
+	}
+}
+
+// sendBatch encodes batch as a single NDJSON request and sends it to APM
+// Server, retrying on 5xx responses and network errors with capped
+// exponential backoff. Any error that survives retries is reported via
+// e.options.OnError.
+func (e *Exporter) sendBatch(batch []interface{}) {
+	body, err := e.encodeBatch(batch)
+	if err != nil {
+		e.options.OnError(err)
+		return
+	}
+
+	backoff := initialBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := e.postBatch(body)
+		if err == nil {
+			return
+		}
+
+		if attempt >= maxSendRetries || !isRetryable(err) {
+			e.options.OnError(err)
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func isRetryable(err error) bool {
+	var statusErr *apmStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	// Anything else is a network/transport error, which is worth retrying.
+	return true
+}
+
+func (e *Exporter) postBatch(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	e.setAuthHeader(req)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return &apmStatusError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// encodeBatch writes the gzip-compressed NDJSON body for batch: a metadata
+// line followed by one line per span/error/metricset in it.
+func (e *Exporter) encodeBatch(batch []interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+
+	if err := e.writeMetadataLine(gz); err != nil {
+		return nil, err
+	}
+
+	for _, item := range batch {
+		if err := e.writeBatchItem(gz, item); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeBatchItem writes the NDJSON line(s) for a single queued item: a
+// transaction/span plus any errors it carries, or a set of metricsets.
+func (e *Exporter) writeBatchItem(w io.Writer, item interface{}) error {
+	switch v := item.(type) {
+	case *trace.SpanData:
+		if err := writeSpanDataLine(w, v, e.options.IncludeSpanEvents); err != nil {
+			return err
+		}
+		for _, apmErr := range errorsFromSpanData(v) {
+			if err := writeErrorLine(w, apmErr); err != nil {
+				return err
+			}
+		}
+	case *view.Data:
+		for _, ms := range viewDataToMetricsets(v) {
+			if err := writeMetricsetLine(w, ms); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeSpanDataLine writes data's transaction/span NDJSON line. When
+// includeSpanEvents is set, data's Annotations and MessageEvents are folded
+// into extra tags on the document, since APM Server's intake v2 protocol
+// has no separate span-log event type to carry them.
+func writeSpanDataLine(w io.Writer, data *trace.SpanData, includeSpanEvents bool) error {
+	var encoded fastjson.Writer
+	envelopeKey := "span"
+
+	if isTransaction(data) {
+		envelopeKey = "transaction"
+		tx := spanDataToTransaction(data)
+		if includeSpanEvents {
+			tx.Context.Tags = append(tx.Context.Tags, eventTags(data)...)
+		}
+		fastjson.Marshal(&encoded, tx)
+	} else {
+		sp := spanDataToSpan(data)
+		if includeSpanEvents {
+			sp.Context.Tags = append(sp.Context.Tags, eventTags(data)...)
+		}
+		fastjson.Marshal(&encoded, sp)
+	}
+
+	if _, err := io.WriteString(w, `{"`+envelopeKey+`":`); err != nil {
+		return err
+	}
+	if _, err := w.Write(encoded.Bytes()); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "}\n")
+	return err
+}
+
+func writeErrorLine(w io.Writer, apmErr *apm.Error) error {
+	var encoded fastjson.Writer
+	fastjson.Marshal(&encoded, apmErr)
+
+	if _, err := io.WriteString(w, `{"error":`); err != nil {
+		return err
+	}
+	if _, err := w.Write(encoded.Bytes()); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "}\n")
+	return err
+}
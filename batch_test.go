@@ -0,0 +1,117 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/trace"
+)
+
+// ndjsonLines decodes a gzip NDJSON request body into its raw lines,
+// skipping the leading metadata line.
+func ndjsonLines(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	defer gz.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+
+	require.NotEmpty(t, lines)
+	return lines[1:]
+}
+
+func TestExporterFlushSendsGzippedNDJSON(t *testing.T) {
+	var requests [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		requests = append(requests, body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	e := NewExporter(srv.URL, Options{MaxBatchInterval: time.Hour})
+	defer e.Close()
+
+	e.ExportSpan(&trace.SpanData{Name: "/foo"})
+
+	require.NoError(t, e.Flush(context.Background()))
+	require.Len(t, requests, 1)
+
+	lines := ndjsonLines(t, requests[0])
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"transaction"`)
+}
+
+func TestExporterDropsSpansWhenQueueIsFull(t *testing.T) {
+	// The background worker receives from the queue as soon as a span is
+	// enqueued, so it is not started here: with nothing draining a queue of
+	// size 1, the first span fills it and the other two are dropped.
+	e := &Exporter{queue: make(chan interface{}, 1)}
+
+	e.ExportSpan(&trace.SpanData{Name: "/foo"})
+	e.ExportSpan(&trace.SpanData{Name: "/bar"})
+	e.ExportSpan(&trace.SpanData{Name: "/baz"})
+
+	assert.Equal(t, uint64(2), e.Dropped())
+}
+
+func TestExporterCloseStopsTheWorker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	e := NewExporter(srv.URL, Options{MaxBatchInterval: time.Hour})
+
+	done := make(chan struct{})
+	go func() {
+		e.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return; background worker leaked")
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(&apmStatusError{StatusCode: 503}))
+	assert.False(t, isRetryable(&apmStatusError{StatusCode: 400}))
+	assert.True(t, isRetryable(errors.New("connection reset")))
+}
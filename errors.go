@@ -0,0 +1,144 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	apm "go.elastic.co/apm/model"
+	"go.opencensus.io/trace"
+)
+
+// statusCodeNames maps OpenCensus status codes, which follow the gRPC
+// status code numbering, to their canonical names.
+var statusCodeNames = map[int32]string{
+	trace.StatusCodeOK:                 "OK",
+	trace.StatusCodeCancelled:          "CANCELLED",
+	trace.StatusCodeUnknown:            "UNKNOWN",
+	trace.StatusCodeInvalidArgument:    "INVALID_ARGUMENT",
+	trace.StatusCodeDeadlineExceeded:   "DEADLINE_EXCEEDED",
+	trace.StatusCodeNotFound:           "NOT_FOUND",
+	trace.StatusCodeAlreadyExists:      "ALREADY_EXISTS",
+	trace.StatusCodePermissionDenied:   "PERMISSION_DENIED",
+	trace.StatusCodeResourceExhausted:  "RESOURCE_EXHAUSTED",
+	trace.StatusCodeFailedPrecondition: "FAILED_PRECONDITION",
+	trace.StatusCodeAborted:            "ABORTED",
+	trace.StatusCodeOutOfRange:         "OUT_OF_RANGE",
+	trace.StatusCodeUnimplemented:      "UNIMPLEMENTED",
+	trace.StatusCodeInternal:           "INTERNAL",
+	trace.StatusCodeUnavailable:        "UNAVAILABLE",
+	trace.StatusCodeDataLoss:           "DATA_LOSS",
+	trace.StatusCodeUnauthenticated:    "UNAUTHENTICATED",
+}
+
+func statusCodeName(code int32) string {
+	if name, ok := statusCodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("STATUS_CODE_%d", code)
+}
+
+// newErrorID generates a random ID for an APM error document. Error.ID is a
+// model.TraceID under the hood - APM Server just treats it as an opaque
+// unique identifier, not an actual trace ID.
+func newErrorID() apm.TraceID {
+	var id apm.TraceID
+	rand.Read(id[:])
+	return id
+}
+
+// transactionIDFor returns the ID of the transaction data belongs to: its
+// own ID if data is itself a transaction, or its parent's ID otherwise.
+func transactionIDFor(data *trace.SpanData) apm.SpanID {
+	if isTransaction(data) {
+		return apm.SpanID(data.SpanContext.SpanID)
+	}
+	return apm.SpanID(data.ParentSpanID)
+}
+
+// errorFromSpanData converts a failed span's Status into an APM error
+// document, or returns nil when data completed without error.
+func errorFromSpanData(data *trace.SpanData) *apm.Error {
+	if data.Status.Code == opencensusStatusCodeOK {
+		return nil
+	}
+
+	return &apm.Error{
+		ID:            newErrorID(),
+		TraceID:       apm.TraceID(data.SpanContext.TraceID),
+		TransactionID: transactionIDFor(data),
+		ParentID:      apm.SpanID(data.SpanContext.SpanID),
+		Timestamp:     apm.Time(data.EndTime),
+		Culprit:       data.Name,
+		Exception: apm.Exception{
+			Message: data.Status.Message,
+			Type:    statusCodeName(data.Status.Code),
+			Code:    apm.ExceptionCode{String: fmt.Sprintf("%d", data.Status.Code)},
+		},
+	}
+}
+
+// errorsFromAnnotations converts annotations that look like errors -
+// those carrying a truthy "error" attribute or a "message" attribute -
+// into APM error documents.
+func errorsFromAnnotations(data *trace.SpanData) []*apm.Error {
+	var errs []*apm.Error
+
+	for _, annotation := range data.Annotations {
+		isError, _ := annotation.Attributes["error"].(bool)
+		message, hasMessage := annotation.Attributes["message"].(string)
+
+		if !isError && !hasMessage {
+			continue
+		}
+
+		if message == "" {
+			message = annotation.Message
+		}
+
+		errs = append(errs, &apm.Error{
+			ID:            newErrorID(),
+			TraceID:       apm.TraceID(data.SpanContext.TraceID),
+			TransactionID: transactionIDFor(data),
+			ParentID:      apm.SpanID(data.SpanContext.SpanID),
+			Timestamp:     apm.Time(annotation.Time),
+			Culprit:       data.Name,
+			Exception: apm.Exception{
+				Message:    message,
+				Attributes: annotation.Attributes,
+			},
+		})
+	}
+
+	return errs
+}
+
+// errorsFromSpanData returns every APM error document that should be sent
+// alongside data's transaction/span: one for a non-OK Status plus one per
+// error-like annotation.
+//
+// data.MessageEvents are not inspected here: unlike Annotations they carry
+// no message or attributes in this version of go.opencensus.io/trace, so
+// there is nothing on them that could indicate an error.
+func errorsFromSpanData(data *trace.SpanData) []*apm.Error {
+	errs := errorsFromAnnotations(data)
+
+	if err := errorFromSpanData(data); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
@@ -0,0 +1,66 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+)
+
+func TestErrorFromSpanData(t *testing.T) {
+	now := time.Now()
+
+	okData := &trace.SpanData{
+		SpanContext: trace.SpanContext{SpanID: trace.SpanID{1}},
+		EndTime:     now,
+		Status:      trace.Status{Code: opencensusStatusCodeOK},
+	}
+	assert.Nil(t, errorFromSpanData(okData))
+
+	failedData := &trace.SpanData{
+		SpanContext: trace.SpanContext{SpanID: trace.SpanID{1}},
+		EndTime:     now,
+		Name:        "/foo",
+		Status:      trace.Status{Code: trace.StatusCodeNotFound, Message: "not found"},
+	}
+
+	got := errorFromSpanData(failedData)
+	assert.NotNil(t, got)
+	assert.Equal(t, "/foo", got.Culprit)
+	assert.Equal(t, "not found", got.Exception.Message)
+	assert.Equal(t, "NOT_FOUND", got.Exception.Type)
+}
+
+func TestErrorsFromAnnotations(t *testing.T) {
+	now := time.Now()
+
+	data := &trace.SpanData{
+		SpanContext: trace.SpanContext{SpanID: trace.SpanID{1}},
+		Status:      trace.Status{Code: opencensusStatusCodeOK},
+		Annotations: []trace.Annotation{
+			{Time: now, Message: "cache miss"},
+			{Time: now, Message: "db error", Attributes: map[string]interface{}{"error": true}},
+			{Time: now, Attributes: map[string]interface{}{"message": "timed out"}},
+		},
+	}
+
+	errs := errorsFromAnnotations(data)
+	assert.Len(t, errs, 2)
+	assert.Equal(t, "db error", errs[0].Exception.Message)
+	assert.Equal(t, "timed out", errs[1].Exception.Message)
+}
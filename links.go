@@ -0,0 +1,45 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"fmt"
+
+	apm "go.elastic.co/apm/model"
+	"go.opencensus.io/trace"
+)
+
+// linkTags flattens OpenCensus span links into tags prefixed with the
+// link's position. go.elastic.co/apm/model has no span_links concept in
+// this version, so the linked trace/span IDs and attributes are reported
+// as tags rather than dropped.
+func linkTags(links []trace.Link) apm.IfaceMap {
+	var tags apm.IfaceMap
+
+	for i, link := range links {
+		tags = append(tags,
+			apm.IfaceMapItem{Key: fmt.Sprintf("link.%d.trace_id", i), Value: link.TraceID.String()},
+			apm.IfaceMapItem{Key: fmt.Sprintf("link.%d.span_id", i), Value: link.SpanID.String()},
+		)
+		for key, value := range tagsToMap(link.Attributes) {
+			tags = append(tags, apm.IfaceMapItem{
+				Key:   fmt.Sprintf("link.%d.%s", i, key),
+				Value: value,
+			})
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,40 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apm "go.elastic.co/apm/model"
+	"go.opencensus.io/trace"
+)
+
+func TestLinkTags(t *testing.T) {
+	assert.Nil(t, linkTags(nil))
+
+	links := []trace.Link{
+		{
+			TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+			Attributes: map[string]interface{}{"queue": "orders"},
+		},
+	}
+
+	tags := linkTags(links)
+	assert.Contains(t, tags, apm.IfaceMapItem{Key: "link.0.trace_id", Value: "0102030405060708090a0b0c0d0e0f10"})
+	assert.Contains(t, tags, apm.IfaceMapItem{Key: "link.0.span_id", Value: "0102030405060708"})
+	assert.Contains(t, tags, apm.IfaceMapItem{Key: "link.0.queue", Value: "orders"})
+}
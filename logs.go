@@ -0,0 +1,65 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"fmt"
+
+	apm "go.elastic.co/apm/model"
+	"go.opencensus.io/trace"
+)
+
+// eventTags flattens data's Annotations and MessageEvents into tags
+// prefixed with the event's position. APM Server's intake v2 protocol has
+// no span-log event type in this version - only metadata, transaction,
+// span, error and metricset documents are accepted - so in-span events are
+// reported as extra tags on the transaction/span itself rather than as a
+// separate document. Callers should only include these when
+// IncludeSpanEvents is set, since it can multiply the size of each
+// transaction/span.
+func eventTags(data *trace.SpanData) apm.IfaceMap {
+	var tags apm.IfaceMap
+
+	i := 0
+	for _, annotation := range data.Annotations {
+		tags = append(tags, apm.IfaceMapItem{Key: fmt.Sprintf("event.%d.message", i), Value: annotation.Message})
+		for key, value := range tagsToMap(annotation.Attributes) {
+			tags = append(tags, apm.IfaceMapItem{Key: fmt.Sprintf("event.%d.%s", i, key), Value: value})
+		}
+		i++
+	}
+
+	for _, event := range data.MessageEvents {
+		tags = append(tags, apm.IfaceMapItem{Key: fmt.Sprintf("event.%d.message", i), Value: messageEventText(event)})
+		i++
+	}
+
+	return tags
+}
+
+func messageEventText(event trace.MessageEvent) string {
+	return fmt.Sprintf("%s message id=%d size=%d", messageEventTypeName(event.EventType), event.MessageID, event.UncompressedByteSize)
+}
+
+func messageEventTypeName(t trace.MessageEventType) string {
+	switch t {
+	case trace.MessageEventTypeSent:
+		return "sent"
+	case trace.MessageEventTypeRecv:
+		return "recv"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apm "go.elastic.co/apm/model"
+	"go.opencensus.io/trace"
+)
+
+func TestEventTags(t *testing.T) {
+	now := time.Now()
+
+	data := &trace.SpanData{
+		SpanContext: trace.SpanContext{SpanID: trace.SpanID{1}},
+		Annotations: []trace.Annotation{
+			{Time: now, Message: "retrying", Attributes: map[string]interface{}{"attempt": int64(2)}},
+		},
+		MessageEvents: []trace.MessageEvent{
+			{Time: now, EventType: trace.MessageEventTypeSent, MessageID: 1, UncompressedByteSize: 128},
+		},
+	}
+
+	tags := eventTags(data)
+	assert.Contains(t, tags, apm.IfaceMapItem{Key: "event.0.message", Value: "retrying"})
+	assert.Contains(t, tags, apm.IfaceMapItem{Key: "event.0.attempt", Value: "2"})
+	assert.Contains(t, tags, apm.IfaceMapItem{Key: "event.1.message", Value: "sent message id=1 size=128"})
+}
@@ -0,0 +1,118 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+
+	apm "go.elastic.co/apm/model"
+	"go.elastic.co/fastjson"
+)
+
+// writeMetadataLine writes the NDJSON metadata line that must precede every
+// transaction/span/error/metricset line in a request to APM Server.
+func (e *Exporter) writeMetadataLine(w io.Writer) error {
+	var serviceEncoded fastjson.Writer
+	fastjson.Marshal(&serviceEncoded, e.buildService())
+
+	var processEncoded fastjson.Writer
+	fastjson.Marshal(&processEncoded, e.buildProcess())
+
+	var systemEncoded fastjson.Writer
+	fastjson.Marshal(&systemEncoded, e.buildSystem())
+
+	if _, err := io.WriteString(w, `{"metadata":{"service":`); err != nil {
+		return err
+	}
+	if _, err := w.Write(serviceEncoded.Bytes()); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"process":`); err != nil {
+		return err
+	}
+	if _, err := w.Write(processEncoded.Bytes()); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"system":`); err != nil {
+		return err
+	}
+	if _, err := w.Write(systemEncoded.Bytes()); err != nil {
+		return err
+	}
+
+	if len(e.options.Labels) > 0 {
+		var labelsEncoded fastjson.Writer
+		fastjson.Marshal(&labelsEncoded, labelsToStringMap(e.options.Labels))
+
+		if _, err := io.WriteString(w, `,"labels":`); err != nil {
+			return err
+		}
+		if _, err := w.Write(labelsEncoded.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "}}\n")
+	return err
+}
+
+func (e *Exporter) buildService() *apm.Service {
+	return &apm.Service{
+		Name:        e.options.ServiceName,
+		Version:     e.options.ServiceVersion,
+		Environment: e.options.ServiceEnvironment,
+		Agent: &apm.Agent{
+			Name:    "opencensus-go",
+			Version: "0.0.1",
+		},
+	}
+}
+
+func (e *Exporter) buildProcess() *apm.Process {
+	return &apm.Process{
+		Pid:  os.Getpid(),
+		Argv: os.Args,
+	}
+}
+
+func (e *Exporter) buildSystem() *apm.System {
+	return &apm.System{
+		Hostname:     e.options.Hostname,
+		Architecture: runtime.GOARCH,
+		Platform:     runtime.GOOS,
+	}
+}
+
+func labelsToStringMap(labels map[string]string) apm.StringMap {
+	stringMap := make(apm.StringMap, 0, len(labels))
+	for key, value := range labels {
+		stringMap = append(stringMap, apm.StringMapItem{Key: key, Value: value})
+	}
+	return stringMap
+}
+
+// setAuthHeader sets the Authorization header APM Server expects, preferring
+// an API key over a secret token when both are configured.
+func (e *Exporter) setAuthHeader(req *http.Request) {
+	switch {
+	case e.options.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+e.options.APIKey)
+	case e.options.SecretToken != "":
+		req.Header.Set("Authorization", "Bearer "+e.options.SecretToken)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apm "go.elastic.co/apm/model"
+)
+
+func TestSetAuthHeader(t *testing.T) {
+	e := &Exporter{options: Options{SecretToken: "s3cr3t"}}
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost", nil)
+	e.setAuthHeader(req)
+	assert.Equal(t, "Bearer s3cr3t", req.Header.Get("Authorization"))
+
+	e = &Exporter{options: Options{SecretToken: "s3cr3t", APIKey: "my-api-key"}}
+	req, _ = http.NewRequest(http.MethodPost, "http://localhost", nil)
+	e.setAuthHeader(req)
+	assert.Equal(t, "ApiKey my-api-key", req.Header.Get("Authorization"))
+
+	e = &Exporter{options: Options{}}
+	req, _ = http.NewRequest(http.MethodPost, "http://localhost", nil)
+	e.setAuthHeader(req)
+	assert.Equal(t, "", req.Header.Get("Authorization"))
+}
+
+func TestLabelsToStringMap(t *testing.T) {
+	stringMap := labelsToStringMap(map[string]string{"team": "infra"})
+	assert.Contains(t, stringMap, apm.StringMapItem{Key: "team", Value: "infra"})
+}
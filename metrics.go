@@ -0,0 +1,115 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.opencensus.io/stats/view"
+)
+
+var _ view.Exporter = (*Exporter)(nil)
+
+// metricset is a single APM Server intake v2 metricset document.
+// go.elastic.co/apm/model has no Metricset/Metric types in this version, so
+// metricset is modeled locally and marshaled with encoding/json rather than
+// fastjson, which only knows how to marshal the real apm.* model types.
+type metricset struct {
+	Timestamp int64             `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Samples   map[string]sample `json:"samples"`
+}
+
+// sample is a single named metric value within a metricset.
+type sample struct {
+	Value float64 `json:"value"`
+}
+
+// ExportView exports recorded view.Data to APM Server as metricsets, over
+// the same queue, worker and connection ExportSpan uses for traces.
+func (e *Exporter) ExportView(vd *view.Data) {
+	e.enqueue(vd)
+}
+
+// sanitizeMetricName replaces "." in name with "_", as required by APM
+// Server's metric.name field so that Elasticsearch doesn't interpret dots
+// as nested object paths.
+func sanitizeMetricName(name string) string {
+	return strings.ReplaceAll(name, ".", "_")
+}
+
+// viewDataToMetricsets converts a single recorded view.Data into one
+// metricset per row, mapping OpenCensus aggregations onto APM samples.
+func viewDataToMetricsets(vd *view.Data) []*metricset {
+	name := sanitizeMetricName(vd.View.Name)
+
+	metricsets := make([]*metricset, 0, len(vd.Rows))
+
+	for _, row := range vd.Rows {
+		tags := make(map[string]string, len(row.Tags))
+		for _, tag := range row.Tags {
+			tags[tag.Key.Name()] = tag.Value
+		}
+
+		metricsets = append(metricsets, &metricset{
+			Timestamp: vd.End.UnixNano() / int64(1e3),
+			Tags:      tags,
+			Samples:   aggregationToSamples(name, row.Data),
+		})
+	}
+
+	return metricsets
+}
+
+func aggregationToSamples(name string, data view.AggregationData) map[string]sample {
+	switch data := data.(type) {
+	case *view.CountData:
+		return map[string]sample{name: {Value: float64(data.Value)}}
+	case *view.SumData:
+		return map[string]sample{name: {Value: data.Value}}
+	case *view.LastValueData:
+		return map[string]sample{name: {Value: data.Value}}
+	case *view.DistributionData:
+		samples := map[string]sample{
+			name + "_count": {Value: float64(data.Count)},
+			name + "_sum":   {Value: data.Mean * float64(data.Count)},
+		}
+		for i, count := range data.CountPerBucket {
+			samples[fmt.Sprintf("%s_bucket_%d", name, i)] = sample{Value: float64(count)}
+		}
+		return samples
+	default:
+		return nil
+	}
+}
+
+func writeMetricsetLine(w io.Writer, ms *metricset) error {
+	encoded, err := json.Marshal(ms)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `{"metricset":`); err != nil {
+		return err
+	}
+	if _, err := w.Write(encoded); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
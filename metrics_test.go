@@ -0,0 +1,63 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func TestSanitizeMetricName(t *testing.T) {
+	assert.Equal(t, "http_server_latency", sanitizeMetricName("http.server.latency"))
+}
+
+func TestAggregationToSamples(t *testing.T) {
+	assert.Equal(t,
+		map[string]sample{"requests": {Value: 5}},
+		aggregationToSamples("requests", &view.CountData{Value: 5}))
+
+	dist := &view.DistributionData{Count: 2, Mean: 3, CountPerBucket: []int64{1, 1}}
+	samples := aggregationToSamples("latency", dist)
+	assert.Equal(t, sample{Value: 2}, samples["latency_count"])
+	assert.Equal(t, sample{Value: 6}, samples["latency_sum"])
+	assert.Equal(t, sample{Value: 1}, samples["latency_bucket_0"])
+	assert.Equal(t, sample{Value: 1}, samples["latency_bucket_1"])
+}
+
+func TestViewDataToMetricsets(t *testing.T) {
+	now := time.Now()
+	key, _ := tag.NewKey("route")
+
+	vd := &view.Data{
+		View: &view.View{Name: "http.server.request_count"},
+		End:  now,
+		Rows: []*view.Row{
+			{
+				Tags: []tag.Tag{{Key: key, Value: "/foo"}},
+				Data: &view.CountData{Value: 1},
+			},
+		},
+	}
+
+	metricsets := viewDataToMetricsets(vd)
+	assert.Len(t, metricsets, 1)
+	assert.Equal(t, now.UnixNano()/int64(1e3), metricsets[0].Timestamp)
+	assert.Equal(t, map[string]string{"route": "/foo"}, metricsets[0].Tags)
+	assert.Equal(t, sample{Value: 1}, metricsets[0].Samples["http_server_request_count"])
+}
@@ -0,0 +1,143 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	defaultBufferMaxSize    = 1000
+	defaultMaxBatchSize     = 100
+	defaultMaxBatchInterval = 1 * time.Second
+)
+
+// Options configures the behavior of an Exporter.
+type Options struct {
+	// BufferMaxSize is the maximum number of spans that may be queued
+	// waiting to be sent to APM Server. Once the buffer is full,
+	// ExportSpan drops spans rather than blocking the caller.
+	//
+	// Defaults to 1000.
+	BufferMaxSize int
+
+	// MaxBatchSize is the maximum number of spans sent to APM Server
+	// in a single request.
+	//
+	// Defaults to 100.
+	MaxBatchSize int
+
+	// MaxBatchInterval is the longest the exporter will hold a partial
+	// batch before flushing it to APM Server.
+	//
+	// Defaults to 1 second.
+	MaxBatchInterval time.Duration
+
+	// OnError, if set, is called with any error encountered while
+	// sending spans to APM Server. If unset, errors are discarded.
+	OnError func(error)
+
+	// ServiceName identifies the reporting service to APM Server.
+	//
+	// Defaults to the ELASTIC_APM_SERVICE_NAME environment variable, then
+	// to "OpenCensus".
+	ServiceName string
+
+	// ServiceVersion is the version of the reporting service.
+	ServiceVersion string
+
+	// ServiceEnvironment distinguishes deployments of the same service,
+	// e.g. "production" or "staging".
+	ServiceEnvironment string
+
+	// Hostname overrides the reported system.hostname.
+	//
+	// Defaults to the machine's hostname.
+	Hostname string
+
+	// Labels are attached to every transaction, span and error reported
+	// by the Exporter.
+	Labels map[string]string
+
+	// SecretToken authenticates with APM Server using a bearer token.
+	//
+	// Defaults to the ELASTIC_APM_SECRET_TOKEN environment variable.
+	SecretToken string
+
+	// APIKey authenticates with APM Server using an API key. APIKey takes
+	// precedence over SecretToken when both are set.
+	//
+	// Defaults to the ELASTIC_APM_API_KEY environment variable.
+	APIKey string
+
+	// TLSConfig configures the TLS client used to talk to APM Server. It
+	// is ignored if HTTPClient is set.
+	TLSConfig *tls.Config
+
+	// HTTPClient overrides the http.Client used to talk to APM Server.
+	HTTPClient *http.Client
+
+	// IncludeSpanEvents, when true, reports each span's Annotations and
+	// MessageEvents to APM Server as extra "event.<n>.*" tags on the
+	// transaction/span document itself. No separate log document is sent
+	// for an event. Off by default since it can significantly increase the
+	// volume of data sent to APM Server.
+	IncludeSpanEvents bool
+}
+
+// withDefaults returns a copy of o with zero-valued fields replaced by
+// their defaults, falling back to the environment variables used by the
+// official Elastic APM agents where applicable.
+func (o Options) withDefaults() Options {
+	if o.BufferMaxSize <= 0 {
+		o.BufferMaxSize = defaultBufferMaxSize
+	}
+	if o.MaxBatchSize <= 0 {
+		o.MaxBatchSize = defaultMaxBatchSize
+	}
+	if o.MaxBatchInterval <= 0 {
+		o.MaxBatchInterval = defaultMaxBatchInterval
+	}
+	if o.OnError == nil {
+		o.OnError = func(error) {}
+	}
+
+	if o.ServiceName == "" {
+		o.ServiceName = envOrDefault("ELASTIC_APM_SERVICE_NAME", defaultServiceName)
+	}
+	if o.SecretToken == "" {
+		o.SecretToken = os.Getenv("ELASTIC_APM_SECRET_TOKEN")
+	}
+	if o.APIKey == "" {
+		o.APIKey = os.Getenv("ELASTIC_APM_API_KEY")
+	}
+	if o.Hostname == "" {
+		if hostname, err := os.Hostname(); err == nil {
+			o.Hostname = hostname
+		}
+	}
+
+	return o
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,210 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apm
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	apm "go.elastic.co/apm/model"
+	"go.opencensus.io/trace"
+)
+
+// isTransaction reports whether data should be reported to APM Server as a
+// transaction rather than a span: a span is a transaction if it has no
+// parent, or if it represents the server side of an RPC.
+func isTransaction(data *trace.SpanData) bool {
+	return data.ParentSpanID == (trace.SpanID{}) || data.SpanKind == trace.SpanKindServer
+}
+
+// durationMillis converts a SpanData's start/end time into the
+// floating-point number of milliseconds APM Server expects for
+// transaction.duration and span.duration.
+func durationMillis(data *trace.SpanData) float64 {
+	return float64(data.EndTime.Sub(data.StartTime)) / float64(1e6)
+}
+
+func buildTags(data *trace.SpanData, tagsMap map[string]string) apm.IfaceMap {
+	tags := apm.IfaceMap{
+		apm.IfaceMapItem{Key: "status.code", Value: fmt.Sprintf("%d", data.Status.Code)},
+		apm.IfaceMapItem{Key: "status.message", Value: data.Status.Message},
+	}
+
+	// Ensure that if Status.Code is not OK, that we set the "error" tag on the APM span.
+	// See Issue https://github.com/census-instrumentation/opencensus-go/issues/1041
+	if data.Status.Code != opencensusStatusCodeOK {
+		tags = append(tags, apm.IfaceMapItem{Key: "error", Value: "true"})
+	}
+
+	for key, value := range tagsMap {
+		tags = append(tags, apm.IfaceMapItem{Key: key, Value: value})
+	}
+
+	return tags
+}
+
+func buildRequest(tagsMap map[string]string) *apm.Request {
+	if tagsMap["http.host"] == "" {
+		return nil
+	}
+
+	request := &apm.Request{
+		URL:    tagsToURL(tagsMap),
+		Method: tagsMap["http.method"],
+	}
+
+	if tagsMap["http.user_agent"] != "" {
+		request.Headers = []apm.Header{
+			{
+				Key:    "User-Agent",
+				Values: []string{tagsMap["http.user_agent"]},
+			},
+		}
+	}
+
+	return request
+}
+
+func buildResponse(tagsMap map[string]string) *apm.Response {
+	if tagsMap["http.status_code"] == "" {
+		return nil
+	}
+
+	statusCode, _ := strconv.Atoi(tagsMap["http.status_code"])
+	return &apm.Response{StatusCode: statusCode}
+}
+
+// transactionType derives the APM transaction.type from well known
+// attributes, falling back to "unknown" when nothing matches.
+func transactionType(tagsMap map[string]string) string {
+	switch {
+	case tagsMap["http.host"] != "" || tagsMap["http.method"] != "":
+		return "request"
+	case tagsMap["messaging.system"] != "":
+		return "messaging"
+	default:
+		return "unknown"
+	}
+}
+
+// spanType derives the APM span.type/span.subtype from well known
+// attributes describing the downstream call a span represents.
+func spanType(tagsMap map[string]string) (spanType string, subtype string) {
+	switch {
+	case tagsMap["db.type"] != "":
+		return "db", tagsMap["db.type"]
+	case tagsMap["messaging.system"] != "":
+		return "messaging", tagsMap["messaging.system"]
+	case tagsMap["http.host"] != "" || tagsMap["http.method"] != "" || tagsMap["http.url"] != "":
+		return "external", "http"
+	default:
+		return "app", "internal"
+	}
+}
+
+// spanDataToTransaction converts data into an APM transaction. It should
+// only be called when isTransaction(data) is true.
+func spanDataToTransaction(data *trace.SpanData) *apm.Transaction {
+	sampled := data.SpanContext.TraceOptions.IsSampled()
+	tagsMap := tagsToMap(data.Attributes)
+
+	return &apm.Transaction{
+		ID:        apm.SpanID(data.SpanContext.SpanID),
+		TraceID:   apm.TraceID(data.SpanContext.TraceID),
+		ParentID:  apm.SpanID(data.ParentSpanID),
+		Name:      data.Name,
+		Timestamp: apm.Time(data.StartTime),
+		Duration:  durationMillis(data),
+		Type:      transactionType(tagsMap),
+		Result:    data.Status.Message,
+		SpanCount: apm.SpanCount{
+			Dropped: 0,
+			Started: data.ChildSpanCount,
+		},
+		Context: &apm.Context{
+			Tags:     append(buildTags(data, tagsMap), linkTags(data.Links)...),
+			Request:  buildRequest(tagsMap),
+			Response: buildResponse(tagsMap),
+		},
+		Sampled: &sampled,
+	}
+}
+
+// spanDataToSpan converts data into an APM span. It should only be called
+// when isTransaction(data) is false.
+func spanDataToSpan(data *trace.SpanData) *apm.Span {
+	tagsMap := tagsToMap(data.Attributes)
+	typ, subtype := spanType(tagsMap)
+
+	var httpContext *apm.HTTPSpanContext
+	if tagsMap["http.host"] != "" {
+		// apm.HTTPSpanContext has no field for the HTTP method; it is
+		// already carried as the "http.method" tag via buildTags.
+		httpContext = &apm.HTTPSpanContext{
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   tagsMap["http.host"],
+				Path:   tagsMap["http.path"],
+			},
+		}
+		if tagsMap["http.status_code"] != "" {
+			httpContext.StatusCode, _ = strconv.Atoi(tagsMap["http.status_code"])
+		}
+	}
+
+	var dbContext *apm.DatabaseSpanContext
+	if tagsMap["db.type"] != "" {
+		dbContext = &apm.DatabaseSpanContext{
+			Type:      tagsMap["db.type"],
+			Instance:  tagsMap["db.instance"],
+			Statement: tagsMap["db.statement"],
+			User:      tagsMap["db.user"],
+		}
+	}
+
+	var msgContext *apm.MessageSpanContext
+	if tagsMap["messaging.system"] != "" {
+		msgContext = &apm.MessageSpanContext{
+			Queue: &apm.MessageQueueSpanContext{
+				Name: tagsMap["messaging.destination"],
+			},
+		}
+	}
+
+	return &apm.Span{
+		ID:      apm.SpanID(data.SpanContext.SpanID),
+		TraceID: apm.TraceID(data.SpanContext.TraceID),
+		// TransactionID is only correct for a span whose direct parent is
+		// the transaction itself. trace.Exporter only ever sees one
+		// finished SpanData at a time, with no access to the live span
+		// tree, so there is no way to recover the root transaction's ID
+		// for a span nested two or more levels deep - ParentSpanID is the
+		// immediate parent span's ID in that case, not the transaction's.
+		TransactionID: apm.SpanID(data.ParentSpanID),
+		ParentID:      apm.SpanID(data.ParentSpanID),
+		Name:          data.Name,
+		Timestamp:     apm.Time(data.StartTime),
+		Duration:      durationMillis(data),
+		Type:          typ,
+		Subtype:       subtype,
+		Context: &apm.SpanContext{
+			Tags:     append(buildTags(data, tagsMap), linkTags(data.Links)...),
+			HTTP:     httpContext,
+			Database: dbContext,
+			Message:  msgContext,
+		},
+	}
+}